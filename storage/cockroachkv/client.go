@@ -14,6 +14,7 @@ import (
 	monkit "gopkg.in/spacemonkeygo/monkit.v2"
 	"storj.io/storj/internal/dbutil"
 	"storj.io/storj/storage"
+	"storj.io/storj/storage/cockroachkv/migrate"
 )
 
 const (
@@ -27,12 +28,43 @@ var (
 
 // Client is the entrypoint into a cockroachkv data store
 type Client struct {
-	URL    string
-	pgConn *sql.DB
+	URL         string
+	pgConn      *sql.DB
+	batchSize   int
+	skipMigrate bool
 }
 
-// New instantiates a new postgreskv client given db URL
-func New(dbURL string) (*Client, error) {
+// Option customizes the behavior of a Client returned from New.
+type Option func(*Client)
+
+// WithBatchSize overrides the default number of keys that PutAll and DeleteAll
+// will send to CockroachDB in a single statement, which is also the page size
+// IteratePrefix uses when called with a non-positive batchSize. DeletePrefix
+// is not affected. Larger batches mean fewer round trips but bigger
+// transactions. Non-positive
+// values are ignored, since a batch size of zero or less would make the
+// chunking loops in PutAll/DeleteAll/IteratePrefix spin forever.
+func WithBatchSize(batchSize int) Option {
+	return func(client *Client) {
+		if batchSize <= 0 {
+			return
+		}
+		client.batchSize = batchSize
+	}
+}
+
+// WithoutMigration disables the automatic schema migration that New
+// otherwise runs on every connect. Tests that manage their own schema (or
+// want to exercise MigrateTo directly) should use this.
+func WithoutMigration() Option {
+	return func(client *Client) {
+		client.skipMigrate = true
+	}
+}
+
+// New instantiates a new cockroachkv client given a db URL, migrating the
+// schema up to the latest version unless WithoutMigration is passed.
+func New(dbURL string, options ...Option) (*Client, error) {
 	pgConn, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		return nil, err
@@ -40,15 +72,22 @@ func New(dbURL string) (*Client, error) {
 
 	dbutil.Configure(pgConn, mon)
 
-	// TODO: Need to bring this back but sourcing CockroachDB compatible schema.
-	// err = schema.PrepareDB(pgConn, dbURL)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	return &Client{
-		URL:    dbURL,
-		pgConn: pgConn,
-	}, nil
+	client := &Client{
+		URL:       dbURL,
+		pgConn:    pgConn,
+		batchSize: defaultBatchSize,
+	}
+	for _, option := range options {
+		option(client)
+	}
+
+	if !client.skipMigrate {
+		if err := migrate.To(context.Background(), pgConn, migrate.Steps, -1); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
 }
 
 // Close closes the client
@@ -56,11 +95,27 @@ func (client *Client) Close() error {
 	return client.pgConn.Close()
 }
 
-// TODO: Need to bring this back but sourcing CockroachDB compatible schema.
-// DropSchema drops the schema.
-// func (client *Client) DropSchema(schema string) error {
-// 	return pgutil.DropSchema(client.pgConn, schema)
-// }
+// MigrateTo applies every migration step up to and including version, or
+// every pending step if version is negative. It lets operators roll the
+// schema forward (or deliberately hold it back) independently of New.
+func (client *Client) MigrateTo(ctx context.Context, version int) (err error) {
+	defer mon.Task()(&ctx)(&err)
+	return migrate.To(ctx, client.pgConn, migrate.Steps, version)
+}
+
+// CurrentVersion returns the highest schema version applied so far, or 0 if
+// no migrations have run yet.
+func (client *Client) CurrentVersion(ctx context.Context) (_ int, err error) {
+	defer mon.Task()(&ctx)(&err)
+	return migrate.CurrentVersion(ctx, client.pgConn)
+}
+
+// DropSchema drops the pathdata and cockroachkv_versions tables. It is
+// intended for use in tests only.
+func (client *Client) DropSchema(ctx context.Context) (err error) {
+	defer mon.Task()(&ctx)(&err)
+	return migrate.DropSchema(ctx, client.pgConn)
+}
 
 // Put sets the value for the provided key.
 func (client *Client) Put(ctx context.Context, key storage.Key, value storage.Value) (err error) {
@@ -83,6 +138,79 @@ func (client *Client) PutPath(ctx context.Context, bucket, key storage.Key, valu
 	return err
 }
 
+// PutAll sets values for all provided keys in the default bucket in as few
+// round trips as possible. Items are chunked into batches of client.batchSize
+// and each batch is applied with a single INSERT ... UNNEST statement inside
+// a crdb.ExecuteTx retry loop, so a batch is atomic and safe under
+// CockroachDB's serializable retries.
+func (client *Client) PutAll(ctx context.Context, items []storage.ListItem) (err error) {
+	defer mon.Task()(&ctx)(&err)
+	return client.putAllPath(ctx, storage.Key(defaultBucket), items)
+}
+
+func (client *Client) putAllPath(ctx context.Context, bucket storage.Key, items []storage.ListItem) (err error) {
+	items = dedupeItemsKeepLast(items)
+	for len(items) > 0 {
+		n := len(items)
+		if n > client.batchSize {
+			n = client.batchSize
+		}
+		if err := client.putAllBatch(ctx, bucket, items[:n]); err != nil {
+			return err
+		}
+		items = items[n:]
+	}
+	return nil
+}
+
+// dedupeItemsKeepLast returns items with any duplicate keys removed, keeping
+// the last occurrence of each key (last-write-wins, matching what repeated
+// calls to PutPath would give you). This also keeps putAllBatch's single
+// INSERT ... ON CONFLICT DO UPDATE statement from hitting CockroachDB's
+// "ON CONFLICT DO UPDATE command cannot affect row a second time" error,
+// which a batch containing the same key twice would otherwise trigger.
+func dedupeItemsKeepLast(items []storage.ListItem) []storage.ListItem {
+	lastIndex := make(map[string]int, len(items))
+	for i, item := range items {
+		lastIndex[string(item.Key)] = i
+	}
+	if len(lastIndex) == len(items) {
+		return items
+	}
+
+	deduped := make([]storage.ListItem, 0, len(lastIndex))
+	for i, item := range items {
+		if lastIndex[string(item.Key)] == i {
+			deduped = append(deduped, item)
+		}
+	}
+	return deduped
+}
+
+func (client *Client) putAllBatch(ctx context.Context, bucket storage.Key, items []storage.ListItem) error {
+	buckets := make([][]byte, len(items))
+	paths := make([][]byte, len(items))
+	values := make([][]byte, len(items))
+	for i, item := range items {
+		if item.Key.IsZero() {
+			return storage.ErrEmptyKey.New("")
+		}
+		buckets[i] = []byte(bucket)
+		paths[i] = []byte(item.Key)
+		values[i] = []byte(item.Value)
+	}
+
+	return crdb.ExecuteTx(ctx, client.pgConn, nil, func(txn *sql.Tx) error {
+		q := `
+			INSERT INTO pathdata (bucket, fullpath, metadata)
+				SELECT * FROM unnest($1:::BYTEA[], $2:::BYTEA[], $3:::BYTEA[])
+				ON CONFLICT (bucket, fullpath) DO UPDATE SET metadata = EXCLUDED.metadata
+		`
+		_, err := txn.ExecContext(ctx, q, pq.ByteaArray(buckets), pq.ByteaArray(paths), pq.ByteaArray(values))
+		return Error.Wrap(err)
+	})
+}
+
 // Get looks up the provided key and returns its value (or an error).
 func (client *Client) Get(ctx context.Context, key storage.Key) (_ storage.Value, err error) {
 	defer mon.Task()(&ctx)(&err)
@@ -175,6 +303,35 @@ func (client *Client) DeletePath(ctx context.Context, bucket, key storage.Key) (
 	return nil
 }
 
+// DeleteAll deletes the given keys (in the given bucket) in as few round
+// trips as possible. Keys are chunked into batches of client.batchSize and
+// each batch is deleted with a single DELETE ... WHERE fullpath = ANY(...)
+// statement inside a crdb.ExecuteTx retry loop, so a batch is atomic and
+// safe under CockroachDB's serializable retries. Unlike DeletePath, it does
+// not error when some of the keys are not found.
+func (client *Client) DeleteAll(ctx context.Context, bucket storage.Key, keys storage.Keys) (err error) {
+	defer mon.Task()(&ctx)(&err)
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > client.batchSize {
+			n = client.batchSize
+		}
+		if err := client.deleteAllBatch(ctx, bucket, keys[:n]); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+func (client *Client) deleteAllBatch(ctx context.Context, bucket storage.Key, keys storage.Keys) error {
+	return crdb.ExecuteTx(ctx, client.pgConn, nil, func(txn *sql.Tx) error {
+		q := "DELETE FROM pathdata WHERE bucket = $1:::BYTEA AND fullpath = ANY($2:::BYTEA[])"
+		_, err := txn.ExecContext(ctx, q, []byte(bucket), pq.ByteaArray(keys.ByteSlices()))
+		return Error.Wrap(err)
+	})
+}
+
 // List returns either a list of known keys, in order, or an error.
 func (client *Client) List(ctx context.Context, first storage.Key, limit int) (_ storage.Keys, err error) {
 	defer mon.Task()(&ctx)(&err)
@@ -293,4 +450,4 @@ func (client *Client) CompareAndSwapPath(ctx context.Context, bucket, key storag
 
 		return nil
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,60 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package cockroachkv
+
+import (
+	"testing"
+
+	"storj.io/storj/storage"
+)
+
+func TestDedupeItemsKeepLast(t *testing.T) {
+	items := []storage.ListItem{
+		{Key: storage.Key("a"), Value: storage.Value("1")},
+		{Key: storage.Key("b"), Value: storage.Value("1")},
+		{Key: storage.Key("a"), Value: storage.Value("2")},
+		{Key: storage.Key("c"), Value: storage.Value("1")},
+		{Key: storage.Key("b"), Value: storage.Value("2")},
+	}
+
+	got := dedupeItemsKeepLast(items)
+
+	want := map[string]string{"a": "2", "b": "2", "c": "1"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d items, want %d: %+v", len(got), len(want), got)
+	}
+	for _, item := range got {
+		if string(item.Value) != want[string(item.Key)] {
+			t.Errorf("key %q = %q, want %q", item.Key, item.Value, want[string(item.Key)])
+		}
+	}
+}
+
+func TestDedupeItemsKeepLastNoDuplicates(t *testing.T) {
+	items := []storage.ListItem{
+		{Key: storage.Key("a"), Value: storage.Value("1")},
+		{Key: storage.Key("b"), Value: storage.Value("1")},
+	}
+
+	got := dedupeItemsKeepLast(items)
+	if len(got) != len(items) {
+		t.Fatalf("got %d items, want %d", len(got), len(items))
+	}
+}
+
+func TestWithBatchSizeIgnoresNonPositive(t *testing.T) {
+	for _, batchSize := range []int{0, -1, -100} {
+		client := &Client{batchSize: defaultBatchSize}
+		WithBatchSize(batchSize)(client)
+		if client.batchSize != defaultBatchSize {
+			t.Errorf("WithBatchSize(%d) changed batchSize to %d, want unchanged %d", batchSize, client.batchSize, defaultBatchSize)
+		}
+	}
+
+	client := &Client{batchSize: defaultBatchSize}
+	WithBatchSize(5)(client)
+	if client.batchSize != 5 {
+		t.Errorf("WithBatchSize(5) = %d, want 5", client.batchSize)
+	}
+}
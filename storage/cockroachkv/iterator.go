@@ -0,0 +1,38 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package cockroachkv
+
+import (
+	"bytes"
+	"context"
+
+	"storj.io/storj/storage"
+)
+
+// newOrderedCockroachIterator builds the ordered iterator backing Iterate:
+// a key-ordered scan of the default bucket, scoped to opts.Prefix and
+// starting at opts.First. opts.Recurse is not consulted: every key under
+// opts.Prefix is returned individually in key order, and no prefix
+// (IsPrefix) entries are produced.
+func newOrderedCockroachIterator(ctx context.Context, client *Client, opts storage.IterateOptions, batchSize int) (*prefixIterator, error) {
+	return newOrderedCockroachIteratorWithOptions(ctx, client, opts, batchSize, ReadOptions{})
+}
+
+// newOrderedCockroachIteratorWithOptions is newOrderedCockroachIterator plus
+// readOpts, so IterateWithOptions can serve the scan from a follower replica.
+func newOrderedCockroachIteratorWithOptions(ctx context.Context, client *Client, opts storage.IterateOptions, batchSize int, readOpts ReadOptions) (*prefixIterator, error) {
+	start := iterateStartKey(opts)
+	return newRangeIterator(ctx, client, storage.Key(defaultBucket), start, opts.Prefix, batchSize, readOpts)
+}
+
+// iterateStartKey returns the lower bound of the range to scan: opts.First
+// if it sorts after opts.Prefix (the caller is resuming a previous listing),
+// or opts.Prefix itself otherwise.
+func iterateStartKey(opts storage.IterateOptions) storage.Key {
+	start := opts.Prefix
+	if len(opts.First) > 0 && bytes.Compare([]byte(opts.First), []byte(start)) > 0 {
+		start = opts.First
+	}
+	return start
+}
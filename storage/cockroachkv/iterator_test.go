@@ -0,0 +1,39 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package cockroachkv
+
+import (
+	"bytes"
+	"testing"
+
+	"storj.io/storj/storage"
+)
+
+func TestIterateStartKey(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts storage.IterateOptions
+		want storage.Key
+	}{
+		{name: "no prefix or first", opts: storage.IterateOptions{}, want: nil},
+		{name: "prefix only", opts: storage.IterateOptions{Prefix: storage.Key("a/")}, want: storage.Key("a/")},
+		{
+			name: "first after prefix wins",
+			opts: storage.IterateOptions{Prefix: storage.Key("a/"), First: storage.Key("a/b")},
+			want: storage.Key("a/b"),
+		},
+		{
+			name: "first before prefix is ignored",
+			opts: storage.IterateOptions{Prefix: storage.Key("b/"), First: storage.Key("a/z")},
+			want: storage.Key("b/"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := iterateStartKey(tt.opts)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("iterateStartKey(%+v) = %v, want %v", tt.opts, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package migrate implements a minimal, ordered schema migration runner for
+// the cockroachkv storage backend. Each Step creates or alters exactly one
+// piece of schema and is applied at most once; applied versions are
+// recorded in the cockroachkv_versions table so that New can be called
+// repeatedly (and concurrently, across processes) without redoing work.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/zeebo/errs"
+)
+
+// Error is the class of errors returned by this package.
+var Error = errs.Class("migrate error")
+
+// Step describes a single schema change and the version it brings the
+// database to once applied.
+type Step struct {
+	Version     int
+	Description string
+	Action      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Steps is the versioned list of schema changes for the cockroachkv backend,
+// in ascending version order. Append new steps to the end; never edit or
+// reorder a step once it has shipped.
+var Steps = []Step{
+	{
+		Version:     1,
+		Description: "create pathdata table",
+		Action: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS pathdata (
+					bucket   BYTEA NOT NULL,
+					fullpath BYTEA NOT NULL,
+					metadata BYTEA NOT NULL,
+					PRIMARY KEY (bucket, fullpath)
+				)
+			`)
+			return err
+		},
+	},
+}
+
+const versionsTableDDL = `
+	CREATE TABLE IF NOT EXISTS cockroachkv_versions (
+		version     INT NOT NULL PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+	)
+`
+
+func ensureVersionsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, versionsTableDDL)
+	return Error.Wrap(err)
+}
+
+// CurrentVersion returns the highest version applied to db, or 0 if no
+// migrations have run yet.
+func CurrentVersion(ctx context.Context, db *sql.DB) (int, error) {
+	if err := ensureVersionsTable(ctx, db); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	row := db.QueryRowContext(ctx, "SELECT max(version) FROM cockroachkv_versions")
+	if err := row.Scan(&version); err != nil {
+		return 0, Error.Wrap(err)
+	}
+	return int(version.Int64), nil
+}
+
+// pendingSteps returns the steps in steps whose version is greater than
+// current and, if target is non-negative, no greater than target, in order.
+// It is kept free of I/O so the ordering/bounds logic can be unit tested
+// without a database.
+func pendingSteps(steps []Step, current, target int) []Step {
+	var pending []Step
+	for _, step := range steps {
+		if step.Version <= current {
+			continue
+		}
+		if target >= 0 && step.Version > target {
+			break
+		}
+		pending = append(pending, step)
+	}
+	return pending
+}
+
+// To applies every step in steps whose version is greater than db's current
+// version, in order, stopping once target is reached. Passing a negative
+// target applies every remaining step. Each step runs inside its own
+// crdb.ExecuteTx retry loop together with the bookkeeping insert, so a step
+// is either fully applied and recorded, or not applied at all. The
+// bookkeeping insert is idempotent (ON CONFLICT DO NOTHING), so two
+// processes racing to apply the same step both succeed: whichever commits
+// second just no-ops instead of hitting a primary-key violation.
+func To(ctx context.Context, db *sql.DB, steps []Step, target int) error {
+	if err := ensureVersionsTable(ctx, db); err != nil {
+		return err
+	}
+
+	current, err := CurrentVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range pendingSteps(steps, current, target) {
+		step := step
+		err := crdb.ExecuteTx(ctx, db, nil, func(tx *sql.Tx) error {
+			if err := step.Action(ctx, tx); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO cockroachkv_versions (version, description) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING",
+				step.Version, step.Description)
+			return err
+		})
+		if err != nil {
+			return Error.Wrap(errs.New("migrating to version %d: %v", step.Version, err))
+		}
+	}
+	return nil
+}
+
+// DropSchema drops every table managed by Steps, plus the version-tracking
+// table itself. It is intended for use in tests only.
+func DropSchema(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS pathdata, cockroachkv_versions")
+	return Error.Wrap(err)
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testSteps() []Step {
+	return []Step{
+		{Version: 1, Description: "one"},
+		{Version: 2, Description: "two"},
+		{Version: 3, Description: "three"},
+	}
+}
+
+func versions(steps []Step) []int {
+	versions := make([]int, len(steps))
+	for i, step := range steps {
+		versions[i] = step.Version
+	}
+	return versions
+}
+
+func TestPendingSteps(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		current int
+		target  int
+		want    []int
+	}{
+		{name: "fresh database, apply everything", current: 0, target: -1, want: []int{1, 2, 3}},
+		{name: "fresh database, stop at target", current: 0, target: 2, want: []int{1, 2}},
+		{name: "partially migrated, apply remainder", current: 1, target: -1, want: []int{2, 3}},
+		{name: "partially migrated, target already reached", current: 2, target: 2, want: nil},
+		{name: "fully migrated", current: 3, target: -1, want: nil},
+		{name: "target below current is a no-op", current: 3, target: 1, want: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := versions(pendingSteps(testSteps(), tt.current, tt.target))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pendingSteps(steps, %d, %d) = %v, want %v", tt.current, tt.target, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package cockroachkv
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/zeebo/errs"
+	"storj.io/storj/storage"
+)
+
+// prefixUpperBound returns the smallest key that sorts strictly after every
+// key having the given prefix, by incrementing the last byte of prefix and
+// propagating the carry into the preceding bytes. If prefix is empty or
+// consists entirely of 0xFF bytes, there is no finite key larger than every
+// key with that prefix, so ok is false and the caller should leave the
+// upper bound off the range.
+func prefixUpperBound(prefix storage.Key) (upper storage.Key, ok bool) {
+	upper = append(storage.Key{}, prefix...)
+	for i := len(upper) - 1; i >= 0; i-- {
+		upper[i]++
+		if upper[i] != 0 {
+			return upper[:i+1], true
+		}
+	}
+	return nil, false
+}
+
+// IteratePrefix iterates over all keys in bucket beginning with prefix, in
+// key order, pushing the bucket+prefix range down into the SQL WHERE clause
+// and paging batchSize rows at a time. This lets callers like bucket-empty
+// and GC discover which keys are in scope without pulling every key in the
+// bucket over the wire first.
+func (client *Client) IteratePrefix(ctx context.Context, bucket, prefix storage.Key, batchSize int, fn func(context.Context, storage.Iterator) error) (err error) {
+	defer mon.Task()(&ctx)(&err)
+	if batchSize <= 0 {
+		batchSize = client.batchSize
+	}
+
+	it, err := newPrefixIterator(ctx, client, bucket, prefix, batchSize, ReadOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errs.Combine(err, it.Close())
+	}()
+
+	return fn(ctx, it)
+}
+
+// DeletePrefix deletes every key in bucket beginning with prefix in a
+// single DELETE statement inside a crdb.ExecuteTx retry loop, returning the
+// number of keys removed. This lets bucket-empty and GC operations run
+// entirely server-side instead of listing and deleting keys one at a time.
+func (client *Client) DeletePrefix(ctx context.Context, bucket, prefix storage.Key) (deleted int64, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	upper, hasUpper := prefixUpperBound(prefix)
+	err = crdb.ExecuteTx(ctx, client.pgConn, nil, func(txn *sql.Tx) error {
+		var (
+			res sql.Result
+			err error
+		)
+		if hasUpper {
+			q := `
+				DELETE FROM pathdata
+					WHERE bucket = $1:::BYTEA AND fullpath >= $2:::BYTEA AND fullpath < $3:::BYTEA
+					RETURNING NOTHING
+			`
+			res, err = txn.ExecContext(ctx, q, []byte(bucket), []byte(prefix), []byte(upper))
+		} else {
+			q := `
+				DELETE FROM pathdata
+					WHERE bucket = $1:::BYTEA AND fullpath >= $2:::BYTEA
+					RETURNING NOTHING
+			`
+			res, err = txn.ExecContext(ctx, q, []byte(bucket), []byte(prefix))
+		}
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		deleted, err = res.RowsAffected()
+		return Error.Wrap(err)
+	})
+	return deleted, err
+}
+
+// prefixIterator pages through a bucket-scoped range of pathdata batchSize
+// at a time, ordered by fullpath, so that resuming after a page boundary is
+// just a WHERE fullpath > $last clause. Its lower bound is start and its
+// upper bound (if any) is the increment of prefix; IteratePrefix passes
+// start == prefix, while the more general newOrderedCockroachIterator
+// passes start == max(opts.Prefix, opts.First) so it can additionally honor
+// opts.First. readOpts optionally adds an AS OF SYSTEM TIME clause for
+// follower/stale reads.
+type prefixIterator struct {
+	client    *Client
+	bucket    storage.Key
+	upper     storage.Key
+	hasUpper  bool
+	readOpts  ReadOptions
+	batchSize int
+
+	last      storage.Key
+	exclusive bool
+	count     int
+
+	rows *sql.Rows
+}
+
+func newPrefixIterator(ctx context.Context, client *Client, bucket, prefix storage.Key, batchSize int, readOpts ReadOptions) (*prefixIterator, error) {
+	return newRangeIterator(ctx, client, bucket, prefix, prefix, batchSize, readOpts)
+}
+
+func newRangeIterator(ctx context.Context, client *Client, bucket, start, prefix storage.Key, batchSize int, readOpts ReadOptions) (*prefixIterator, error) {
+	upper, hasUpper := prefixUpperBound(prefix)
+	it := &prefixIterator{
+		client:    client,
+		bucket:    bucket,
+		upper:     upper,
+		hasUpper:  hasUpper,
+		readOpts:  readOpts,
+		batchSize: batchSize,
+		last:      start,
+	}
+	if err := it.fetchBatch(ctx); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+func (it *prefixIterator) fetchBatch(ctx context.Context) error {
+	cmp := ">="
+	if it.exclusive {
+		cmp = ">"
+	}
+	asOf := asOfSystemTimeClause(it.readOpts)
+
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if it.hasUpper {
+		q := `
+			SELECT fullpath, metadata FROM pathdata` + asOf + `
+				WHERE bucket = $1:::BYTEA AND fullpath ` + cmp + ` $2:::BYTEA AND fullpath < $3:::BYTEA
+				ORDER BY fullpath ASC
+				LIMIT $4
+		`
+		rows, err = it.client.pgConn.QueryContext(ctx, q, []byte(it.bucket), []byte(it.last), []byte(it.upper), it.batchSize)
+	} else {
+		q := `
+			SELECT fullpath, metadata FROM pathdata` + asOf + `
+				WHERE bucket = $1:::BYTEA AND fullpath ` + cmp + ` $2:::BYTEA
+				ORDER BY fullpath ASC
+				LIMIT $3
+		`
+		rows, err = it.client.pgConn.QueryContext(ctx, q, []byte(it.bucket), []byte(it.last), it.batchSize)
+	}
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	it.rows = rows
+	it.count = 0
+	return nil
+}
+
+// Next implements storage.Iterator.
+func (it *prefixIterator) Next(ctx context.Context, item *storage.ListItem) bool {
+	if it.rows == nil {
+		return false
+	}
+
+	if !it.rows.Next() {
+		fullPage := it.count == it.batchSize
+		if err := it.rows.Close(); err != nil {
+			it.rows = nil
+			return false
+		}
+		it.rows = nil
+		if !fullPage {
+			return false
+		}
+
+		it.exclusive = true
+		if err := it.fetchBatch(ctx); err != nil {
+			return false
+		}
+		return it.Next(ctx, item)
+	}
+
+	var path, metadata []byte
+	if err := it.rows.Scan(&path, &metadata); err != nil {
+		_ = it.rows.Close()
+		it.rows = nil
+		return false
+	}
+
+	item.Key = storage.Key(path)
+	item.Value = storage.Value(metadata)
+	item.IsPrefix = false
+
+	it.last = item.Key
+	it.count++
+	return true
+}
+
+// Close releases the resources held by the iterator.
+func (it *prefixIterator) Close() error {
+	if it.rows == nil {
+		return nil
+	}
+	rows := it.rows
+	it.rows = nil
+	return rows.Close()
+}
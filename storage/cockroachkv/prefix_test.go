@@ -0,0 +1,36 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package cockroachkv
+
+import (
+	"bytes"
+	"testing"
+
+	"storj.io/storj/storage"
+)
+
+func TestPrefixUpperBound(t *testing.T) {
+	for _, tt := range []struct {
+		prefix storage.Key
+		upper  storage.Key
+		ok     bool
+	}{
+		{prefix: storage.Key("a"), upper: storage.Key("b"), ok: true},
+		{prefix: storage.Key("ab"), upper: storage.Key("ac"), ok: true},
+		{prefix: storage.Key{0x00}, upper: storage.Key{0x01}, ok: true},
+		{prefix: storage.Key{0x01, 0xff}, upper: storage.Key{0x02}, ok: true},
+		{prefix: storage.Key{0xff, 0xff}, upper: nil, ok: false},
+		{prefix: storage.Key{0xff}, upper: nil, ok: false},
+		{prefix: storage.Key{}, upper: nil, ok: false},
+	} {
+		upper, ok := prefixUpperBound(tt.prefix)
+		if ok != tt.ok {
+			t.Errorf("prefixUpperBound(%v) ok = %v, want %v", tt.prefix, ok, tt.ok)
+			continue
+		}
+		if ok && !bytes.Equal(upper, tt.upper) {
+			t.Errorf("prefixUpperBound(%v) = %v, want %v", tt.prefix, upper, tt.upper)
+		}
+	}
+}
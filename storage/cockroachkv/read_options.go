@@ -0,0 +1,145 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package cockroachkv
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zeebo/errs"
+	"storj.io/storj/storage"
+)
+
+var (
+	followerReads    = mon.Counter("cockroachkv_follower_reads")
+	leaseholderReads = mon.Counter("cockroachkv_leaseholder_reads")
+)
+
+// ReadOptions configures follower/stale reads for the read-only KV
+// operations (GetWithOptions, GetAllWithOptions, IterateWithOptions).
+// CockroachDB's bounded and exact staleness reads only make sense for
+// read-only queries, so ReadOptions is never accepted by CompareAndSwap or
+// any other write path.
+type ReadOptions struct {
+	// Staleness, when positive, adds an AS OF SYSTEM TIME clause to the
+	// generated SELECT so it can be served by a nearby follower replica
+	// instead of the range's leaseholder. Zero or negative values are
+	// treated as "no staleness" (a regular leaseholder read), since a
+	// negative offset into the past is meaningless.
+	Staleness time.Duration
+	// ExactBounded selects an exact staleness read (AS OF SYSTEM TIME
+	// '-Xs', with X taken from Staleness) instead of CockroachDB's
+	// recommended bounded staleness read (AS OF SYSTEM TIME
+	// follower_read_timestamp()). Ignored when Staleness is not positive.
+	ExactBounded bool
+}
+
+// asOfSystemTimeClause renders the AS OF SYSTEM TIME clause for opts, or the
+// empty string if opts requests a regular leaseholder read.
+func asOfSystemTimeClause(opts ReadOptions) string {
+	if opts.Staleness <= 0 {
+		return ""
+	}
+	if opts.ExactBounded {
+		return fmt.Sprintf(" AS OF SYSTEM TIME '-%.3fs'", opts.Staleness.Seconds())
+	}
+	return " AS OF SYSTEM TIME follower_read_timestamp()"
+}
+
+func recordReadKind(opts ReadOptions) {
+	if opts.Staleness <= 0 {
+		leaseholderReads.Inc(1)
+		return
+	}
+	followerReads.Inc(1)
+}
+
+// GetWithOptions looks up the provided key and returns its value (or an
+// error), honoring opts for follower/stale reads.
+func (client *Client) GetWithOptions(ctx context.Context, key storage.Key, opts ReadOptions) (_ storage.Value, err error) {
+	defer mon.Task()(&ctx)(&err)
+	return client.getPathWithOptions(ctx, storage.Key(defaultBucket), key, opts)
+}
+
+func (client *Client) getPathWithOptions(ctx context.Context, bucket, key storage.Key, opts ReadOptions) (_ storage.Value, err error) {
+	if key.IsZero() {
+		return nil, storage.ErrEmptyKey.New("")
+	}
+	recordReadKind(opts)
+
+	q := "SELECT metadata FROM pathdata" + asOfSystemTimeClause(opts) + " WHERE bucket = $1:::BYTEA AND fullpath = $2:::BYTEA"
+	row := client.pgConn.QueryRowContext(ctx, q, []byte(bucket), []byte(key))
+
+	var val []byte
+	err = row.Scan(&val)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrKeyNotFound.New("%q", key)
+	}
+	return val, Error.Wrap(err)
+}
+
+// GetAllWithOptions finds all values for the provided keys (up to
+// storage.LookupLimit), honoring opts for follower/stale reads. If more keys
+// are provided than the maximum, an error will be returned.
+func (client *Client) GetAllWithOptions(ctx context.Context, keys storage.Keys, opts ReadOptions) (_ storage.Values, err error) {
+	defer mon.Task()(&ctx)(&err)
+	return client.getAllPathWithOptions(ctx, storage.Key(defaultBucket), keys, opts)
+}
+
+// getAllQuery builds the GetAllWithOptions statement. The AS OF
+// SYSTEM TIME clause, when present, must come before the table alias -
+// CockroachDB's grammar is "FROM pathdata AS OF SYSTEM TIME ... AS pd", not
+// "FROM pathdata AS pd AS OF SYSTEM TIME ...".
+func getAllQuery(opts ReadOptions) string {
+	return `
+		SELECT metadata
+		FROM pathdata` + asOfSystemTimeClause(opts) + ` AS pd
+			RIGHT JOIN
+				unnest($2:::BYTEA[]) WITH ORDINALITY pk(request, ord)
+			ON (pd.fullpath = pk.request AND pd.bucket = $1:::BYTEA)
+		ORDER BY pk.ord
+	`
+}
+
+func (client *Client) getAllPathWithOptions(ctx context.Context, bucket storage.Key, keys storage.Keys, opts ReadOptions) (_ storage.Values, err error) {
+	if len(keys) > storage.LookupLimit {
+		return nil, storage.ErrLimitExceeded
+	}
+	recordReadKind(opts)
+
+	q := getAllQuery(opts)
+	rows, err := client.pgConn.QueryContext(ctx, q, []byte(bucket), pq.ByteaArray(keys.ByteSlices()))
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	values := make([]storage.Value, 0, len(keys))
+	for rows.Next() {
+		var value []byte
+		if err := rows.Scan(&value); err != nil {
+			return nil, errs.Wrap(errs.Combine(err, rows.Close()))
+		}
+		values = append(values, storage.Value(value))
+	}
+	return values, errs.Combine(rows.Err(), rows.Close())
+}
+
+// IterateWithOptions behaves like Iterate, but honors readOpts for
+// follower/stale reads.
+func (client *Client) IterateWithOptions(ctx context.Context, opts storage.IterateOptions, readOpts ReadOptions, fn func(context.Context, storage.Iterator) error) (err error) {
+	defer mon.Task()(&ctx)(&err)
+	recordReadKind(readOpts)
+
+	opi, err := newOrderedCockroachIteratorWithOptions(ctx, client, opts, defaultBatchSize, readOpts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errs.Combine(err, opi.Close())
+	}()
+
+	return fn(ctx, opi)
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package cockroachkv
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsOfSystemTimeClause(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts ReadOptions
+		want string
+	}{
+		{name: "zero staleness", opts: ReadOptions{}, want: ""},
+		{
+			name: "bounded staleness uses the recommended default",
+			opts: ReadOptions{Staleness: 5 * time.Second},
+			want: " AS OF SYSTEM TIME follower_read_timestamp()",
+		},
+		{
+			name: "exact staleness uses an explicit offset",
+			opts: ReadOptions{Staleness: 5 * time.Second, ExactBounded: true},
+			want: " AS OF SYSTEM TIME '-5.000s'",
+		},
+		{
+			name: "exact staleness renders sub-second durations",
+			opts: ReadOptions{Staleness: 250 * time.Millisecond, ExactBounded: true},
+			want: " AS OF SYSTEM TIME '-0.250s'",
+		},
+		{
+			name: "negative staleness is treated as no staleness",
+			opts: ReadOptions{Staleness: -5 * time.Second, ExactBounded: true},
+			want: "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := asOfSystemTimeClause(tt.opts)
+			if got != tt.want {
+				t.Errorf("asOfSystemTimeClause(%+v) = %q, want %q", tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllQueryClauseOrder(t *testing.T) {
+	q := getAllQuery(ReadOptions{Staleness: 5 * time.Second})
+
+	asOf := strings.Index(q, "AS OF SYSTEM TIME")
+	alias := strings.Index(q, "AS pd")
+	if asOf == -1 || alias == -1 {
+		t.Fatalf("expected query to contain both clauses, got: %s", q)
+	}
+	if asOf > alias {
+		t.Errorf("AS OF SYSTEM TIME must precede the table alias, got: %s", q)
+	}
+
+	noStaleness := getAllQuery(ReadOptions{})
+	if strings.Contains(noStaleness, "AS OF SYSTEM TIME") {
+		t.Errorf("query should not contain AS OF SYSTEM TIME when staleness is zero, got: %s", noStaleness)
+	}
+}
+
+func TestRecordReadKindDoesNotPanic(t *testing.T) {
+	recordReadKind(ReadOptions{Staleness: time.Second})
+	recordReadKind(ReadOptions{})
+}